@@ -0,0 +1,218 @@
+package flowpilot
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+// KeyProvider supplies the symmetric keys used by EncryptedStash to encrypt and decrypt sensitive paths. It
+// allows callers to plug in their own KMS and to rotate keys without invalidating in-flight flows: values
+// encrypted under an older key remain decryptable as long as KeyByID can still resolve it.
+type KeyProvider interface {
+	// CurrentKey returns the key id and key bytes to use for new encryption operations.
+	CurrentKey() (id string, key []byte, err error)
+	// KeyByID returns the key bytes previously identified by id, e.g. to decrypt values written under a key
+	// that has since been rotated out as the current one.
+	KeyByID(id string) ([]byte, error)
+}
+
+// encryptedValue is the ciphertext envelope stored in place of a sensitive path's plaintext value. The
+// surrounding stash structure (history, scheduled states, ...) stays plaintext and queryable.
+type encryptedValue struct {
+	KeyID string `json:"kid"`
+	Nonce string `json:"n"`
+	Data  string `json:"ct"`
+}
+
+// EncryptedStash decorates a Stash so that values written under a configured set of sensitive paths are
+// transparently encrypted at rest using AES-GCM, while the rest of the stash remains plaintext.
+type EncryptedStash struct {
+	Stash
+	keyProvider    KeyProvider
+	sensitivePaths map[string]struct{}
+}
+
+// NewEncryptedStash wraps inner so that writes and reads under paths are transparently encrypted and decrypted
+// using keys obtained from kp.
+func NewEncryptedStash(inner Stash, kp KeyProvider, paths []string) *EncryptedStash {
+	sensitivePaths := make(map[string]struct{}, len(paths))
+	for _, path := range paths {
+		sensitivePaths[path] = struct{}{}
+	}
+
+	return &EncryptedStash{Stash: inner, keyProvider: kp, sensitivePaths: sensitivePaths}
+}
+
+// NewEncryptedStashFromString creates an EncryptedStash from the given serialized JSON data.
+func NewEncryptedStashFromString(data string, kp KeyProvider, paths []string) (*EncryptedStash, error) {
+	inner, err := NewStashFromString(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewEncryptedStash(inner, kp, paths), nil
+}
+
+// Set stashes value at path, transparently encrypting it first if path is configured as sensitive.
+func (s *EncryptedStash) Set(path string, value any) error {
+	if _, sensitive := s.sensitivePaths[path]; !sensitive {
+		return s.Stash.Set(path, value)
+	}
+
+	plaintext, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to marshal value at %q for encryption: %w", path, err)
+	}
+
+	envelope, err := s.encrypt(plaintext)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt value at %q: %w", path, err)
+	}
+
+	return s.Stash.Set(path, envelope)
+}
+
+// Get returns the value stashed at path, transparently decrypting it first if path is configured as sensitive.
+// If decryption fails for any reason, the zero gjson.Result is returned.
+func (s *EncryptedStash) Get(path string) gjson.Result {
+	result := s.Stash.Get(path)
+
+	if _, sensitive := s.sensitivePaths[path]; !sensitive || !result.Exists() {
+		return result
+	}
+
+	var envelope encryptedValue
+	if err := json.Unmarshal([]byte(result.Raw), &envelope); err != nil {
+		return gjson.Result{}
+	}
+
+	plaintext, err := s.decrypt(envelope)
+	if err != nil {
+		return gjson.Result{}
+	}
+
+	return gjson.ParseBytes(plaintext)
+}
+
+// SetWithTTL stashes value at path with an expiration, transparently encrypting it first if path is configured
+// as sensitive, the same way Set does.
+func (s *EncryptedStash) SetWithTTL(path string, value any, ttl time.Duration) error {
+	if _, sensitive := s.sensitivePaths[path]; !sensitive {
+		return s.Stash.SetWithTTL(path, value, ttl)
+	}
+
+	plaintext, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to marshal value at %q for encryption: %w", path, err)
+	}
+
+	envelope, err := s.encrypt(plaintext)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt value at %q: %w", path, err)
+	}
+
+	return s.Stash.SetWithTTL(path, envelope, ttl)
+}
+
+// GetFresh returns the value stashed at path via SetWithTTL, transparently decrypting it first if path is
+// configured as sensitive, the same way Get does. If the entry has expired or decryption fails for any reason,
+// the zero gjson.Result is returned.
+func (s *EncryptedStash) GetFresh(path string) gjson.Result {
+	result := s.Stash.GetFresh(path)
+
+	if _, sensitive := s.sensitivePaths[path]; !sensitive || !result.Exists() {
+		return result
+	}
+
+	var envelope encryptedValue
+	if err := json.Unmarshal([]byte(result.Raw), &envelope); err != nil {
+		return gjson.Result{}
+	}
+
+	plaintext, err := s.decrypt(envelope)
+	if err != nil {
+		return gjson.Result{}
+	}
+
+	return gjson.ParseBytes(plaintext)
+}
+
+// encrypt seals plaintext with the key provider's current key, returning the resulting ciphertext envelope.
+func (s *EncryptedStash) encrypt(plaintext []byte) (encryptedValue, error) {
+	keyID, key, err := s.keyProvider.CurrentKey()
+	if err != nil {
+		return encryptedValue{}, fmt.Errorf("failed to obtain current key: %w", err)
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return encryptedValue{}, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return encryptedValue{}, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	ciphertext := aead.Seal(nil, nonce, plaintext, nil)
+
+	return encryptedValue{
+		KeyID: keyID,
+		Nonce: base64.StdEncoding.EncodeToString(nonce),
+		Data:  base64.StdEncoding.EncodeToString(ciphertext),
+	}, nil
+}
+
+// decrypt opens the ciphertext envelope using the key identified by envelope.KeyID, allowing previously
+// rotated-out keys to still be resolved via KeyByID.
+func (s *EncryptedStash) decrypt(envelope encryptedValue) ([]byte, error) {
+	key, err := s.keyProvider.KeyByID(envelope.KeyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to obtain key %q: %w", envelope.KeyID, err)
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce, err := base64.StdEncoding.DecodeString(envelope.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode nonce: %w", err)
+	}
+
+	ciphertext, err := base64.StdEncoding.DecodeString(envelope.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode ciphertext: %w", err)
+	}
+
+	plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt value: %w", err)
+	}
+
+	return plaintext, nil
+}
+
+// newAEAD builds an AES-GCM cipher.AEAD from key.
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AEAD: %w", err)
+	}
+
+	return aead, nil
+}
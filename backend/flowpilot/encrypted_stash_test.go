@@ -0,0 +1,81 @@
+package flowpilot
+
+import (
+	"crypto/rand"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// staticKeyProvider is a fixed-key KeyProvider for tests; it does not exercise rotation.
+type staticKeyProvider struct {
+	id  string
+	key []byte
+}
+
+func newStaticKeyProvider(t *testing.T) *staticKeyProvider {
+	t.Helper()
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	return &staticKeyProvider{id: "key-1", key: key}
+}
+
+func (p *staticKeyProvider) CurrentKey() (string, []byte, error) {
+	return p.id, p.key, nil
+}
+
+func (p *staticKeyProvider) KeyByID(id string) ([]byte, error) {
+	if id != p.id {
+		return nil, fmt.Errorf("unknown key id %q", id)
+	}
+
+	return p.key, nil
+}
+
+func TestEncryptedStash_SetGet_EncryptsSensitivePaths(t *testing.T) {
+	inner := NewStash()
+	kp := newStaticKeyProvider(t)
+	s := NewEncryptedStash(inner, kp, []string{"passcode.code"})
+
+	if err := s.Set("passcode.code", "123456"); err != nil {
+		t.Fatalf("failed to set passcode.code: %v", err)
+	}
+
+	if err := s.Set("public.field", "visible"); err != nil {
+		t.Fatalf("failed to set public.field: %v", err)
+	}
+
+	if got := inner.Get("passcode.code").String(); got == "123456" {
+		t.Fatal("expected the sensitive path to be stored encrypted in the inner stash")
+	}
+
+	if got := inner.Get("public.field").String(); got != "visible" {
+		t.Fatalf("expected the non-sensitive path to be stored as plaintext, got %q", got)
+	}
+
+	if got := s.Get("passcode.code").String(); got != "123456" {
+		t.Fatalf("expected the sensitive path to decrypt transparently, got %q", got)
+	}
+}
+
+func TestEncryptedStash_SetWithTTL_GetFresh_EncryptsSensitivePaths(t *testing.T) {
+	inner := NewStash()
+	kp := newStaticKeyProvider(t)
+	s := NewEncryptedStash(inner, kp, []string{"passcode.code"})
+
+	if err := s.SetWithTTL("passcode.code", "654321", time.Hour); err != nil {
+		t.Fatalf("failed to set passcode.code with ttl: %v", err)
+	}
+
+	if got := inner.Get("_.ttl.passcode.code.v").String(); got == "654321" {
+		t.Fatal("expected the ttl-stashed sensitive value to be stored encrypted in the inner stash")
+	}
+
+	if got := s.GetFresh("passcode.code").String(); got != "654321" {
+		t.Fatalf("expected the sensitive ttl value to decrypt transparently, got %q", got)
+	}
+}
@@ -3,9 +3,41 @@ package flowpilot
 import (
 	"errors"
 	"fmt"
+	"io"
+	"time"
+
 	"github.com/teamhanko/hanko/backend/flowpilot/jsonmanager"
+	"github.com/tidwall/gjson"
 )
 
+// HistoryFilter defines the criteria used to filter the results of Stash.StateHistory.
+type HistoryFilter struct {
+	// Size caps the number of returned entries to the most recent ones. Zero or negative means no cap.
+	Size int
+	// Since only includes entries that were entered at or after this point in time. A zero value is ignored.
+	Since time.Time
+	// Delta, if positive, only includes entries entered within this rolling window ending now.
+	Delta time.Duration
+}
+
+// Validate ensures the filter is well-formed and returns an error for combinations that would otherwise
+// result in an unbounded query, e.g. no Size cap together with neither Since nor Delta set.
+func (f HistoryFilter) Validate() error {
+	if f.Size <= 0 && f.Since.IsZero() && f.Delta <= 0 {
+		return errors.New("history filter must specify a positive Size, a Since timestamp, or a Delta window")
+	}
+
+	return nil
+}
+
+// HistoryEntry represents a single, publicly readable state transition recorded in the stash's state history.
+type HistoryEntry struct {
+	State                StateName
+	UnscheduledState     *StateName
+	NumOfScheduledStates *int64
+	EnteredAt            time.Time
+}
+
 // Stash defines the interface for managing JSON data.
 type Stash interface {
 	getLastStateFromHistory() (stateName, unscheduledState *StateName, numOfScheduledStates *int64, err error)
@@ -14,6 +46,38 @@ type Stash interface {
 	addScheduledStates(scheduledStateNames ...StateName) error
 	removeLastScheduledState() (*StateName, error)
 
+	// StateHistory returns the flow's traversed states, filtered by HistoryFilter. A filter that fails
+	// HistoryFilter.Validate is rejected with an error.
+	StateHistory(filter HistoryFilter) ([]HistoryEntry, error)
+
+	// Checkpoint bookmarks the current stash payload under name so it can later be restored via Rewind.
+	Checkpoint(name string) error
+	// Rewind replaces the current stash payload with the one stored under name by Checkpoint.
+	Rewind(name string) error
+	// ListCheckpoints returns the names of all checkpoints currently stored.
+	ListCheckpoints() []string
+	// DeleteCheckpoint removes the checkpoint stored under name, if any.
+	DeleteCheckpoint(name string) error
+
+	// SetWithTTL stashes value at path the same way Set does, but the entry automatically expires after ttl.
+	SetWithTTL(path string, value any, ttl time.Duration) error
+	// GetFresh returns the value stashed at path via SetWithTTL, or the zero gjson.Result if it does not exist
+	// or has expired. An expired entry is evicted as a side effect of calling GetFresh.
+	GetFresh(path string) gjson.Result
+	// SweepExpiredTTL evicts every expired SetWithTTL entry. GetFresh already calls this lazily, but callers
+	// may also call it explicitly, e.g. once per flow tick, to bound the growth of stale entries between GetFresh calls.
+	SweepExpiredTTL() error
+
+	// Marshal returns the stash's current payload serialized as a JSON string.
+	Marshal() string
+	// MarshalChunks splits the stash's serialized payload into ordered, size-bounded chunks of at most maxBytes
+	// each, suitable for backing stores with a size limit per value (cookies, DB rows, ...). Use
+	// NewStashFromChunks to reassemble the stash from the returned chunks.
+	MarshalChunks(maxBytes int) ([]string, error)
+	// MarshalChunksTo behaves like MarshalChunks but streams the resulting chunks to w, one per line, instead
+	// of collecting them in memory.
+	MarshalChunksTo(w io.Writer, maxBytes int) error
+
 	jsonmanager.JSONManager
 }
 
@@ -33,6 +97,16 @@ func NewStashFromString(data string) (Stash, error) {
 	return &defaultStash{JSONManager: jm}, err
 }
 
+// rawJSON returns the raw, serialized JSON document currently held by the stash.
+func (s *defaultStash) rawJSON() string {
+	return s.Get("@this").String()
+}
+
+// Marshal returns the stash's current payload serialized as a JSON string.
+func (s *defaultStash) Marshal() string {
+	return s.rawJSON()
+}
+
 // addStateToHistory adds a stateDetail to the history. Specify the values for unscheduledState and numOfScheduledStates to
 // maintain the list of scheduled states if sub-flows are involved.
 func (s *defaultStash) addStateToHistory(stateName StateName, unscheduledStateName *StateName, numOfScheduledStates *int64) error {
@@ -69,6 +143,11 @@ func (s *defaultStash) addStateToHistory(stateName StateName, unscheduledStateNa
 		}
 	}
 
+	// Record the time the state was entered so history can later be filtered by time.
+	if err = historyItem.Set("t", time.Now().UTC().Format(time.RFC3339)); err != nil {
+		return fmt.Errorf("failed to set entered_at: %w", err)
+	}
+
 	// Add the new history item to the history
 	if err = s.Set("_.state_history.-1", historyItem.Unmarshal()); err != nil {
 		return fmt.Errorf("failed to update stashed history: %w", err)
@@ -180,3 +259,60 @@ func (s *defaultStash) removeLastScheduledState() (*StateName, error) {
 
 	return &nextStateName, nil
 }
+
+// StateHistory returns the flow's traversed states, filtered according to filter. Entries are returned in the
+// order they were entered. If filter.Size is set, only the most recent filter.Size entries (after applying the
+// other filter criteria) are returned.
+func (s *defaultStash) StateHistory(filter HistoryFilter) ([]HistoryEntry, error) {
+	if err := filter.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid history filter: %w", err)
+	}
+
+	since := filter.Since
+	if filter.Delta > 0 {
+		windowStart := time.Now().UTC().Add(-filter.Delta)
+		if since.IsZero() || windowStart.After(since) {
+			since = windowStart
+		}
+	}
+
+	var entries []HistoryEntry
+
+	for _, item := range s.Get("_.state_history").Array() {
+		if !item.IsObject() || !item.Get("s").Exists() {
+			return nil, errors.New("history item is missing a value for 'state'")
+		}
+
+		entry := HistoryEntry{State: StateName(item.Get("s").String())}
+
+		if item.Get("u").Exists() {
+			usn := StateName(item.Get("u").String())
+			entry.UnscheduledState = &usn
+		}
+
+		if item.Get("n").Exists() {
+			n := item.Get("n").Int()
+			entry.NumOfScheduledStates = &n
+		}
+
+		if item.Get("t").Exists() {
+			enteredAt, err := time.Parse(time.RFC3339, item.Get("t").String())
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse entered_at: %w", err)
+			}
+			entry.EnteredAt = enteredAt
+		}
+
+		if !since.IsZero() && entry.EnteredAt.Before(since) {
+			continue
+		}
+
+		entries = append(entries, entry)
+	}
+
+	if filter.Size > 0 && len(entries) > filter.Size {
+		entries = entries[len(entries)-filter.Size:]
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,107 @@
+package flowpilot
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/teamhanko/hanko/backend/flowpilot/jsonmanager"
+)
+
+// Checkpoint serializes the current stash payload, including "_.state_history" and "_.scheduled_states", and
+// stores it under "_.checkpoints.<name>" so it can later be restored with Rewind. The "_.checkpoints" and
+// "_.ttl" subtrees are stripped from the snapshot itself, since neither is meant to be rewound and including
+// them would make each checkpoint embed every checkpoint (and TTL entry) that came before it. Calling
+// Checkpoint again with the same name overwrites the previously stored snapshot.
+func (s *defaultStash) Checkpoint(name string) error {
+	if len(name) == 0 {
+		return fmt.Errorf("checkpoint name must not be empty")
+	}
+
+	snapshot, err := s.snapshotWithoutCheckpointsAndTTL()
+	if err != nil {
+		return fmt.Errorf("failed to snapshot stash for checkpoint %q: %w", name, err)
+	}
+
+	if err = s.Set(fmt.Sprintf("_.checkpoints.%s", name), snapshot); err != nil {
+		return fmt.Errorf("failed to stash checkpoint %q: %w", name, err)
+	}
+
+	return nil
+}
+
+// snapshotWithoutCheckpointsAndTTL returns the raw, serialized JSON document currently held by the stash, with
+// the "_.checkpoints" and "_.ttl" subtrees removed.
+func (s *defaultStash) snapshotWithoutCheckpointsAndTTL() (string, error) {
+	snapshot, err := jsonmanager.NewJSONManagerFromString(s.rawJSON())
+	if err != nil {
+		return "", err
+	}
+
+	if err = snapshot.Delete("_.checkpoints"); err != nil {
+		return "", fmt.Errorf("failed to strip checkpoints from snapshot: %w", err)
+	}
+
+	if err = snapshot.Delete("_.ttl"); err != nil {
+		return "", fmt.Errorf("failed to strip ttl entries from snapshot: %w", err)
+	}
+
+	return snapshot.Get("@this").String(), nil
+}
+
+// Rewind atomically replaces the current stash payload with the one stored under name, dropping any history or
+// scheduled states that were added after the checkpoint was taken. Since checkpoints themselves (and any live
+// TTL entries) are excluded from what Checkpoint snapshots, they are carried over from the live stash onto the
+// restored payload rather than being discarded, so a checkpoint remains available to Rewind to again afterwards.
+func (s *defaultStash) Rewind(name string) error {
+	checkpoint := s.Get(fmt.Sprintf("_.checkpoints.%s", name))
+	if !checkpoint.Exists() {
+		return fmt.Errorf("checkpoint %q does not exist", name)
+	}
+
+	liveCheckpoints := s.Get("_.checkpoints")
+	liveTTL := s.Get("_.ttl")
+
+	jm, err := jsonmanager.NewJSONManagerFromString(checkpoint.String())
+	if err != nil {
+		return fmt.Errorf("failed to restore checkpoint %q: %w", name, err)
+	}
+
+	if liveCheckpoints.Exists() {
+		if err = jm.Set("_.checkpoints", liveCheckpoints.Value()); err != nil {
+			return fmt.Errorf("failed to restore checkpoints while rewinding to %q: %w", name, err)
+		}
+	}
+
+	if liveTTL.Exists() {
+		if err = jm.Set("_.ttl", liveTTL.Value()); err != nil {
+			return fmt.Errorf("failed to restore ttl entries while rewinding to %q: %w", name, err)
+		}
+	}
+
+	s.JSONManager = jm
+
+	return nil
+}
+
+// ListCheckpoints returns the names of all checkpoints currently stored, in lexical order.
+func (s *defaultStash) ListCheckpoints() []string {
+	names := make([]string, 0)
+
+	for name := range s.Get("_.checkpoints").Map() {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// DeleteCheckpoint removes the checkpoint stored under name. It is not an error to delete a checkpoint that
+// does not exist.
+func (s *defaultStash) DeleteCheckpoint(name string) error {
+	if err := s.Delete(fmt.Sprintf("_.checkpoints.%s", name)); err != nil {
+		return fmt.Errorf("failed to delete checkpoint %q: %w", name, err)
+	}
+
+	return nil
+}
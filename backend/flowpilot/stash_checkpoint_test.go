@@ -0,0 +1,134 @@
+package flowpilot
+
+import (
+	"testing"
+)
+
+func TestStash_CheckpointAndRewind(t *testing.T) {
+	s := NewStash()
+
+	if err := s.Set("counter", 1); err != nil {
+		t.Fatalf("failed to set counter: %v", err)
+	}
+
+	if err := s.Checkpoint("before"); err != nil {
+		t.Fatalf("failed to checkpoint: %v", err)
+	}
+
+	if err := s.Set("counter", 2); err != nil {
+		t.Fatalf("failed to update counter: %v", err)
+	}
+
+	if err := s.Rewind("before"); err != nil {
+		t.Fatalf("failed to rewind: %v", err)
+	}
+
+	if got := s.Get("counter").Int(); got != 1 {
+		t.Fatalf("expected counter to be restored to 1, got %d", got)
+	}
+}
+
+func TestStash_Rewind_UnknownCheckpoint(t *testing.T) {
+	s := NewStash()
+
+	if err := s.Rewind("missing"); err == nil {
+		t.Fatal("expected an error when rewinding an unknown checkpoint")
+	}
+}
+
+// TestStash_Rewind_PreservesCheckpoints guards against Rewind erasing checkpoints from the live stash, which
+// would make it impossible to rewind to the same checkpoint a second time (e.g. on a second user cancel into
+// the same MFA sub-flow).
+func TestStash_Rewind_PreservesCheckpoints(t *testing.T) {
+	s := NewStash()
+
+	if err := s.Set("counter", 1); err != nil {
+		t.Fatalf("failed to set counter: %v", err)
+	}
+
+	if err := s.Checkpoint("before"); err != nil {
+		t.Fatalf("failed to checkpoint: %v", err)
+	}
+
+	if err := s.Set("counter", 2); err != nil {
+		t.Fatalf("failed to update counter: %v", err)
+	}
+
+	if err := s.Rewind("before"); err != nil {
+		t.Fatalf("failed to rewind: %v", err)
+	}
+
+	names := s.ListCheckpoints()
+	if len(names) != 1 || names[0] != "before" {
+		t.Fatalf("expected checkpoint 'before' to survive a rewind, got %v", names)
+	}
+
+	if err := s.Set("counter", 3); err != nil {
+		t.Fatalf("failed to update counter: %v", err)
+	}
+
+	if err := s.Rewind("before"); err != nil {
+		t.Fatalf("expected to be able to rewind to 'before' a second time, got: %v", err)
+	}
+
+	if got := s.Get("counter").Int(); got != 1 {
+		t.Fatalf("expected counter to be restored to 1 again, got %d", got)
+	}
+}
+
+func TestStash_ListAndDeleteCheckpoints(t *testing.T) {
+	s := NewStash()
+
+	if err := s.Checkpoint("a"); err != nil {
+		t.Fatalf("failed to checkpoint a: %v", err)
+	}
+
+	if err := s.Checkpoint("b"); err != nil {
+		t.Fatalf("failed to checkpoint b: %v", err)
+	}
+
+	names := s.ListCheckpoints()
+	if len(names) != 2 || names[0] != "a" || names[1] != "b" {
+		t.Fatalf("expected checkpoints [a b], got %v", names)
+	}
+
+	if err := s.DeleteCheckpoint("a"); err != nil {
+		t.Fatalf("failed to delete checkpoint a: %v", err)
+	}
+
+	names = s.ListCheckpoints()
+	if len(names) != 1 || names[0] != "b" {
+		t.Fatalf("expected checkpoints [b], got %v", names)
+	}
+}
+
+// TestStash_Checkpoint_DoesNotCompound guards against a checkpoint snapshot embedding previous checkpoints,
+// which would make repeated checkpointing of the same flow (e.g. once per retry loop iteration) blow up the
+// size of the stash payload.
+func TestStash_Checkpoint_DoesNotCompound(t *testing.T) {
+	s := NewStash()
+
+	// Give the stash a "_" subtree up front, so the first snapshot has the same shape as later ones, which keep
+	// "_" after "_.checkpoints" is stripped from it.
+	if err := s.addStateToHistory("state_a", nil, nil); err != nil {
+		t.Fatalf("failed to add state_a to history: %v", err)
+	}
+
+	if err := s.Checkpoint("first"); err != nil {
+		t.Fatalf("failed to checkpoint: %v", err)
+	}
+
+	firstSize := len(s.Get("_.checkpoints.first").Raw)
+
+	for i := 0; i < 10; i++ {
+		if err := s.Checkpoint("repeated"); err != nil {
+			t.Fatalf("failed to checkpoint: %v", err)
+		}
+	}
+
+	repeatedSize := len(s.Get("_.checkpoints.repeated").Raw)
+
+	if repeatedSize > firstSize*2 {
+		t.Fatalf("expected checkpoint size to stay roughly constant across repeated checkpoints, first=%d repeated=%d", firstSize, repeatedSize)
+	}
+}
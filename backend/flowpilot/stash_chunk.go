@@ -0,0 +1,223 @@
+package flowpilot
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/teamhanko/hanko/backend/flowpilot/jsonmanager"
+)
+
+// stashChunk is a single, ordered slice of a chunked stash payload, together with a manifest that allows the
+// reassembled payload to be verified for completeness and integrity.
+type stashChunk struct {
+	V      int    `json:"v"`      // index of this chunk, 0-based
+	N      int    `json:"n"`      // total number of chunks
+	D      string `json:"d"`      // this chunk's slice of the serialized payload
+	SHA256 string `json:"sha256"` // hex-encoded sha256 digest of the full, reassembled payload
+}
+
+// MarshalChunks splits the stash's serialized payload into ordered, size-bounded chunks of at most maxBytes each.
+func (s *defaultStash) MarshalChunks(maxBytes int) ([]string, error) {
+	chunks, err := chunkPayload(s.rawJSON(), maxBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]string, len(chunks))
+
+	for i, chunk := range chunks {
+		encoded, err := json.Marshal(chunk)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode chunk %d: %w", i, err)
+		}
+
+		out[i] = string(encoded)
+	}
+
+	return out, nil
+}
+
+// MarshalChunksTo behaves like MarshalChunks but streams the resulting chunks to w, one JSON object per line,
+// instead of collecting them in memory.
+func (s *defaultStash) MarshalChunksTo(w io.Writer, maxBytes int) error {
+	chunks, err := chunkPayload(s.rawJSON(), maxBytes)
+	if err != nil {
+		return err
+	}
+
+	for i, chunk := range chunks {
+		encoded, err := json.Marshal(chunk)
+		if err != nil {
+			return fmt.Errorf("failed to encode chunk %d: %w", i, err)
+		}
+
+		if _, err = w.Write(append(encoded, '\n')); err != nil {
+			return fmt.Errorf("failed to write chunk %d: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// chunkManifestOverhead returns the number of bytes the JSON encoding of a stashChunk adds on top of its "d"
+// payload slice, for the given digest. V and N are probed with a generously large placeholder index so the
+// measured overhead stays an upper bound regardless of how many chunks the payload actually ends up needing.
+func chunkManifestOverhead(digest string) (int, error) {
+	const maxPlaceholderIndex = 1_000_000_000
+
+	probe := stashChunk{V: maxPlaceholderIndex, N: maxPlaceholderIndex, D: "", SHA256: digest}
+
+	encoded, err := json.Marshal(probe)
+	if err != nil {
+		return 0, fmt.Errorf("failed to measure chunk manifest overhead: %w", err)
+	}
+
+	return len(encoded), nil
+}
+
+// chunkPayload splits payload into stashChunks whose JSON-encoded size, manifest included, is at most maxBytes.
+func chunkPayload(payload string, maxBytes int) ([]stashChunk, error) {
+	if maxBytes <= 0 {
+		return nil, fmt.Errorf("maxBytes must be greater than 0")
+	}
+
+	sum := sha256.Sum256([]byte(payload))
+	digest := hex.EncodeToString(sum[:])
+
+	overhead, err := chunkManifestOverhead(digest)
+	if err != nil {
+		return nil, err
+	}
+
+	budget := maxBytes - overhead
+	if budget <= 0 {
+		return nil, fmt.Errorf("maxBytes %d is too small to fit the chunk manifest overhead of %d bytes", maxBytes, overhead)
+	}
+
+	// Split on rune boundaries and measure each rune as JSON encodes it, since escaping can grow a slice.
+	var parts []string
+	for start := 0; len(parts) == 0 || start < len(payload); {
+		end, size := start, 0
+		for end < len(payload) {
+			_, width := utf8.DecodeRuneInString(payload[end:])
+			encoded, _ := json.Marshal(payload[end : end+width])
+			if size += len(encoded) - 2; size > budget {
+				break
+			}
+			end += width
+		}
+		if end == start && start < len(payload) {
+			return nil, fmt.Errorf("maxBytes %d is too small to fit a single escaped character of the payload", maxBytes)
+		}
+		parts = append(parts, payload[start:end])
+		start = end
+	}
+
+	n := len(parts)
+	chunks := make([]stashChunk, 0, n)
+
+	for i := 0; i < n; i++ {
+		chunks = append(chunks, stashChunk{V: i, N: n, D: parts[i], SHA256: digest})
+	}
+
+	return chunks, nil
+}
+
+// NewStashFromChunks reassembles a Stash from chunks produced by Stash.MarshalChunks, validating the digest of
+// the reassembled payload against the manifest before parsing it.
+func NewStashFromChunks(chunks []string) (Stash, error) {
+	parsed := make([]stashChunk, len(chunks))
+
+	for i, raw := range chunks {
+		if err := json.Unmarshal([]byte(raw), &parsed[i]); err != nil {
+			return nil, fmt.Errorf("failed to decode chunk %d: %w", i, err)
+		}
+	}
+
+	payload, err := reassembleChunks(parsed)
+	if err != nil {
+		return nil, err
+	}
+
+	jm, err := jsonmanager.NewJSONManagerFromString(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return &defaultStash{JSONManager: jm}, nil
+}
+
+// NewStashFromChunkReader behaves like NewStashFromChunks but reads the chunks from r, one JSON object per line,
+// as written by Stash.MarshalChunksTo.
+func NewStashFromChunkReader(r io.Reader) (Stash, error) {
+	var parsed []stashChunk
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+
+	for scanner.Scan() {
+		var chunk stashChunk
+		if err := json.Unmarshal(scanner.Bytes(), &chunk); err != nil {
+			return nil, fmt.Errorf("failed to decode chunk: %w", err)
+		}
+
+		parsed = append(parsed, chunk)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read chunks: %w", err)
+	}
+
+	payload, err := reassembleChunks(parsed)
+	if err != nil {
+		return nil, err
+	}
+
+	jm, err := jsonmanager.NewJSONManagerFromString(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return &defaultStash{JSONManager: jm}, nil
+}
+
+// reassembleChunks orders chunks by their declared index, concatenates their payload slices, and validates the
+// result against the sha256 digest carried in the manifest.
+func reassembleChunks(chunks []stashChunk) (string, error) {
+	if len(chunks) == 0 {
+		return "", fmt.Errorf("no chunks to reassemble")
+	}
+
+	n := chunks[0].N
+	if n != len(chunks) {
+		return "", fmt.Errorf("expected %d chunks, got %d", n, len(chunks))
+	}
+
+	sorted := make([]stashChunk, len(chunks))
+	copy(sorted, chunks)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].V < sorted[j].V })
+
+	digest := sorted[0].SHA256
+	payload := ""
+
+	for i, chunk := range sorted {
+		if chunk.V != i || chunk.N != n || chunk.SHA256 != digest {
+			return "", fmt.Errorf("inconsistent or missing chunk manifest at index %d", i)
+		}
+
+		payload += chunk.D
+	}
+
+	sum := sha256.Sum256([]byte(payload))
+	if hex.EncodeToString(sum[:]) != digest {
+		return "", fmt.Errorf("reassembled payload failed digest verification")
+	}
+
+	return payload, nil
+}
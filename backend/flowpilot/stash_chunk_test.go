@@ -0,0 +1,110 @@
+package flowpilot
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const chunkTestMaxBytes = 200
+
+func TestStash_MarshalChunks_RoundTrip(t *testing.T) {
+	s := NewStash()
+
+	if err := s.Set("blob", strings.Repeat("x", 500)); err != nil {
+		t.Fatalf("failed to set blob: %v", err)
+	}
+
+	chunks, err := s.MarshalChunks(chunkTestMaxBytes)
+	if err != nil {
+		t.Fatalf("MarshalChunks returned an error: %v", err)
+	}
+
+	if len(chunks) < 2 {
+		t.Fatalf("expected more than one chunk for a payload larger than maxBytes, got %d", len(chunks))
+	}
+
+	restored, err := NewStashFromChunks(chunks)
+	if err != nil {
+		t.Fatalf("NewStashFromChunks returned an error: %v", err)
+	}
+
+	if got := restored.Get("blob").String(); got != strings.Repeat("x", 500) {
+		t.Fatalf("restored blob does not match original")
+	}
+}
+
+// TestStash_MarshalChunks_RespectsMaxBytes guards against the chunk manifest overhead (the "v"/"n"/"sha256"
+// fields and JSON punctuation) pushing an individual chunk's encoded size past maxBytes, which would overflow
+// the exact cookie/DB row limit MarshalChunks exists to respect.
+func TestStash_MarshalChunks_RespectsMaxBytes(t *testing.T) {
+	s := NewStash()
+
+	if err := s.Set("blob", strings.Repeat("x", 500)); err != nil {
+		t.Fatalf("failed to set blob: %v", err)
+	}
+
+	chunks, err := s.MarshalChunks(chunkTestMaxBytes)
+	if err != nil {
+		t.Fatalf("MarshalChunks returned an error: %v", err)
+	}
+
+	for i, chunk := range chunks {
+		if len(chunk) > chunkTestMaxBytes {
+			t.Fatalf("chunk %d is %d bytes, exceeding maxBytes %d", i, len(chunk), chunkTestMaxBytes)
+		}
+	}
+}
+
+func TestStash_MarshalChunks_MaxBytesTooSmallForOverhead(t *testing.T) {
+	s := NewStash()
+
+	if err := s.Set("blob", "some data"); err != nil {
+		t.Fatalf("failed to set blob: %v", err)
+	}
+
+	if _, err := s.MarshalChunks(1); err == nil {
+		t.Fatal("expected an error when maxBytes is too small to fit the manifest overhead")
+	}
+}
+
+func TestStash_MarshalChunksTo_RoundTrip(t *testing.T) {
+	s := NewStash()
+
+	if err := s.Set("blob", strings.Repeat("y", 500)); err != nil {
+		t.Fatalf("failed to set blob: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := s.MarshalChunksTo(&buf, chunkTestMaxBytes); err != nil {
+		t.Fatalf("MarshalChunksTo returned an error: %v", err)
+	}
+
+	restored, err := NewStashFromChunkReader(&buf)
+	if err != nil {
+		t.Fatalf("NewStashFromChunkReader returned an error: %v", err)
+	}
+
+	if got := restored.Get("blob").String(); got != strings.Repeat("y", 500) {
+		t.Fatalf("restored blob does not match original")
+	}
+}
+
+func TestStash_NewStashFromChunks_RejectsTamperedChunk(t *testing.T) {
+	s := NewStash()
+
+	if err := s.Set("blob", strings.Repeat("z", 500)); err != nil {
+		t.Fatalf("failed to set blob: %v", err)
+	}
+
+	chunks, err := s.MarshalChunks(chunkTestMaxBytes)
+	if err != nil {
+		t.Fatalf("MarshalChunks returned an error: %v", err)
+	}
+
+	chunks[0] = strings.Replace(chunks[0], `"d":"`, `"d":"TAMPERED`, 1)
+
+	if _, err = NewStashFromChunks(chunks); err == nil {
+		t.Fatal("expected a digest verification error for a tampered chunk")
+	}
+}
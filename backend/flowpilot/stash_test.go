@@ -0,0 +1,80 @@
+package flowpilot
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHistoryFilter_Validate(t *testing.T) {
+	if err := (HistoryFilter{}).Validate(); err == nil {
+		t.Fatal("expected an error for a filter with no Size, Since, or Delta")
+	}
+
+	if err := (HistoryFilter{Size: 1}).Validate(); err != nil {
+		t.Fatalf("expected Size alone to be valid, got: %v", err)
+	}
+
+	if err := (HistoryFilter{Since: time.Now()}).Validate(); err != nil {
+		t.Fatalf("expected Since alone to be valid, got: %v", err)
+	}
+
+	if err := (HistoryFilter{Delta: time.Minute}).Validate(); err != nil {
+		t.Fatalf("expected Delta alone to be valid, got: %v", err)
+	}
+}
+
+func TestStash_StateHistory(t *testing.T) {
+	s := NewStash()
+
+	if err := s.addStateToHistory("state_a", nil, nil); err != nil {
+		t.Fatalf("failed to add state_a to history: %v", err)
+	}
+
+	if err := s.addStateToHistory("state_b", nil, nil); err != nil {
+		t.Fatalf("failed to add state_b to history: %v", err)
+	}
+
+	entries, err := s.StateHistory(HistoryFilter{Size: 10})
+	if err != nil {
+		t.Fatalf("StateHistory returned an error: %v", err)
+	}
+
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 history entries, got %d", len(entries))
+	}
+
+	if entries[0].State != "state_a" || entries[1].State != "state_b" {
+		t.Fatalf("unexpected history order: %+v", entries)
+	}
+
+	if entries[0].EnteredAt.IsZero() || entries[1].EnteredAt.IsZero() {
+		t.Fatal("expected EnteredAt to be populated for every history entry")
+	}
+
+	if _, err = s.StateHistory(HistoryFilter{}); err == nil {
+		t.Fatal("expected an error for an unbounded history filter")
+	}
+}
+
+func TestStash_StateHistory_Size(t *testing.T) {
+	s := NewStash()
+
+	for _, state := range []StateName{"state_a", "state_b", "state_c"} {
+		if err := s.addStateToHistory(state, nil, nil); err != nil {
+			t.Fatalf("failed to add %s to history: %v", state, err)
+		}
+	}
+
+	entries, err := s.StateHistory(HistoryFilter{Size: 2})
+	if err != nil {
+		t.Fatalf("StateHistory returned an error: %v", err)
+	}
+
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 history entries, got %d", len(entries))
+	}
+
+	if entries[0].State != "state_b" || entries[1].State != "state_c" {
+		t.Fatalf("expected the 2 most recent entries, got %+v", entries)
+	}
+}
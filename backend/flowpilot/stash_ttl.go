@@ -0,0 +1,93 @@
+package flowpilot
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+// ttlPath returns the shadow index path under which the TTL envelope for path is stored.
+func ttlPath(path string) string {
+	return fmt.Sprintf("_.ttl.%s", path)
+}
+
+// SetWithTTL stashes value at path, wrapped in an envelope that records its expiration time. The value can
+// only be read back via GetFresh, which evicts it once ttl has elapsed.
+func (s *defaultStash) SetWithTTL(path string, value any, ttl time.Duration) error {
+	envelope := map[string]any{
+		"v":   value,
+		"exp": time.Now().Add(ttl).UnixNano(),
+	}
+
+	if err := s.Set(ttlPath(path), envelope); err != nil {
+		return fmt.Errorf("failed to stash value with ttl at %q: %w", path, err)
+	}
+
+	return nil
+}
+
+// GetFresh returns the value previously stashed at path via SetWithTTL. If the entry does not exist or has
+// expired, it returns the zero gjson.Result. As a side effect, it lazily sweeps every expired "_.ttl" entry,
+// not just the one at path.
+func (s *defaultStash) GetFresh(path string) gjson.Result {
+	_ = s.SweepExpiredTTL()
+
+	envelope := s.Get(ttlPath(path))
+	if !envelope.Exists() {
+		return gjson.Result{}
+	}
+
+	return envelope.Get("v")
+}
+
+// SweepExpiredTTL evicts every expired entry under the "_.ttl" shadow index. It is invoked lazily by GetFresh,
+// but can also be called explicitly, e.g. once per flow tick, to bound the growth of stale entries between
+// GetFresh calls on other paths.
+func (s *defaultStash) SweepExpiredTTL() error {
+	now := time.Now().UnixNano()
+
+	var expired []string
+	collectExpiredTTL(s.Get("_.ttl"), "", now, &expired)
+
+	for _, path := range expired {
+		if err := s.Delete(fmt.Sprintf("_.ttl.%s", path)); err != nil {
+			return fmt.Errorf("failed to evict expired ttl entry at %q: %w", path, err)
+		}
+	}
+
+	return nil
+}
+
+// collectExpiredTTL walks the "_.ttl" tree rooted at node, appending the dotted path of every expired envelope
+// to expired. TTL paths may themselves contain dots (e.g. "passcode.code"), so envelopes can be nested several
+// levels deep. A node is an envelope, rather than further path nesting, only once it structurally matches the
+// shape SetWithTTL writes: an object with both a "v" key and a numeric "exp" key. Checking the "exp" key's
+// type, not just its presence, avoids mistaking an intermediate path segment literally named "exp" (e.g. from
+// SetWithTTL("session.exp", ...)) for the envelope itself, which would otherwise read as an object-typed "exp"
+// value that gjson coerces to 0, reporting the entry expired immediately regardless of its real ttl.
+func collectExpiredTTL(node gjson.Result, prefix string, now int64, expired *[]string) {
+	if !node.IsObject() {
+		return
+	}
+
+	exp := node.Get("exp")
+	if exp.Type == gjson.Number && node.Get("v").Exists() {
+		if now >= exp.Int() {
+			*expired = append(*expired, prefix)
+		}
+
+		return
+	}
+
+	node.ForEach(func(key, value gjson.Result) bool {
+		childPath := key.String()
+		if prefix != "" {
+			childPath = prefix + "." + childPath
+		}
+
+		collectExpiredTTL(value, childPath, now, expired)
+
+		return true
+	})
+}
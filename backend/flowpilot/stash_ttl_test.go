@@ -0,0 +1,81 @@
+package flowpilot
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStash_SetWithTTL_GetFresh(t *testing.T) {
+	s := NewStash()
+
+	if err := s.SetWithTTL("otp.code", "123456", time.Hour); err != nil {
+		t.Fatalf("failed to set value with ttl: %v", err)
+	}
+
+	if got := s.GetFresh("otp.code").String(); got != "123456" {
+		t.Fatalf("expected 123456, got %q", got)
+	}
+}
+
+func TestStash_GetFresh_ExpiresEntry(t *testing.T) {
+	s := NewStash()
+
+	if err := s.SetWithTTL("otp.code", "123456", 10*time.Millisecond); err != nil {
+		t.Fatalf("failed to set value with ttl: %v", err)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	if result := s.GetFresh("otp.code"); result.Exists() {
+		t.Fatalf("expected expired entry to be gone, got %v", result)
+	}
+
+	if result := s.Get("_.ttl.otp.code"); result.Exists() {
+		t.Fatal("expected GetFresh to have evicted the expired shadow entry")
+	}
+}
+
+func TestStash_SweepExpiredTTL(t *testing.T) {
+	s := NewStash()
+
+	if err := s.SetWithTTL("otp.code", "expired", 10*time.Millisecond); err != nil {
+		t.Fatalf("failed to set expired value: %v", err)
+	}
+
+	if err := s.SetWithTTL("otp.other", "still-fresh", time.Hour); err != nil {
+		t.Fatalf("failed to set fresh value: %v", err)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	if err := s.SweepExpiredTTL(); err != nil {
+		t.Fatalf("SweepExpiredTTL returned an error: %v", err)
+	}
+
+	if result := s.Get("_.ttl.otp.code"); result.Exists() {
+		t.Fatal("expected the expired entry to have been swept")
+	}
+
+	if got := s.GetFresh("otp.other").String(); got != "still-fresh" {
+		t.Fatalf("expected the non-expired entry to survive the sweep, got %q", got)
+	}
+}
+
+// TestStash_SweepExpiredTTL_PathSegmentNamedExp guards against a TTL path whose last segment is literally
+// "exp" (e.g. "session.exp") being mistaken for an envelope one level too early, which would report it
+// expired immediately regardless of its real ttl.
+func TestStash_SweepExpiredTTL_PathSegmentNamedExp(t *testing.T) {
+	s := NewStash()
+
+	if err := s.SetWithTTL("session.exp", "token123", time.Hour); err != nil {
+		t.Fatalf("failed to set value with ttl: %v", err)
+	}
+
+	if err := s.SweepExpiredTTL(); err != nil {
+		t.Fatalf("SweepExpiredTTL returned an error: %v", err)
+	}
+
+	if got := s.GetFresh("session.exp").String(); got != "token123" {
+		t.Fatalf("expected a path ending in 'exp' with an hour-long ttl to still be fresh, got %q", got)
+	}
+}